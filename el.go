@@ -1,6 +1,10 @@
 package camellia
 
 import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+
 	"github.com/arianxx/camellia-io/internal"
 	"time"
 )
@@ -10,18 +14,57 @@ type EventLoop struct {
 	*internal.Selector
 	events         []*Event
 	interval       time.Duration
-	done           bool
 	triggerDataPtr *interface{}
-	periodTasks    []*PeriodTask
+	timers         *timerWheel
+	bus            *eventBus
+
+	tasks      map[TaskID]*cronTask
+	nextTaskID TaskID
+	// TaskResultHandler, if set, is invoked after every ScheduleAt or ScheduleCron task runs.
+	TaskResultHandler TaskResultHandler
+
+	// quiescing is read from Tick (the loop's own goroutine) and written from whichever
+	// goroutine calls Shutdown, and done is read from Run but written from tickDrain or from
+	// whichever goroutine calls Done (e.g. LoopPool.Done, from outside the loop's own
+	// goroutine), so these plus shutdownCtx are kept atomic; everything else below is owned
+	// exclusively by the loop goroutine and driven from within Tick via tickDrain.
+	quiescing   atomic.Bool
+	done        atomic.Bool
+	shutdownCtx atomic.Value // holds the context.Context passed to the first Shutdown call
+
+	quiesceCh    chan struct{} // closed once, when draining begins; see ShouldQuiesce
+	shutdownOnce sync.Once
+	shutdownDone chan struct{} // closed once, when draining finishes; see Shutdown
+	shutdownErr  error         // set before shutdownDone is closed
+
+	draining      bool // true once this loop's Draining hooks have fired
+	shutdownHooks []TriggerProc
+	registeredFDs map[int]struct{}
+	fdCount       int
+
+	throttleRetries map[int]*TimerData
+
+	// regMu guards regQueue, the only other piece of loop state that can be touched from
+	// outside the loop's own goroutine: QueueRegister lets a different goroutine (e.g.
+	// LoopPool.Dispatch, handing an accepted fd to a loop it doesn't own) ask for a
+	// registration, which drainRegisterQueue then performs for real from inside Tick.
+	regMu    sync.Mutex
+	regQueue []*registerRequest
 }
 
 // NewEventLoop creates a new eventloop.
 func NewEventLoop() *EventLoop {
 	return &EventLoop{
-		Selector:    internal.New(1024),
-		events:      []*Event{},
-		periodTasks: []*PeriodTask{},
-		interval:    100 * time.Millisecond,
+		Selector:        internal.New(1024),
+		events:          []*Event{},
+		timers:          newTimerWheel(),
+		bus:             newEventBus(),
+		tasks:           map[TaskID]*cronTask{},
+		quiesceCh:       make(chan struct{}),
+		shutdownDone:    make(chan struct{}),
+		registeredFDs:   map[int]struct{}{},
+		throttleRetries: map[int]*TimerData{},
+		interval:        100 * time.Millisecond,
 	}
 }
 
@@ -31,8 +74,11 @@ func (el *EventLoop) AddEvent(e *Event) {
 }
 
 // AddPeriodTask adds a period task to the eventloop.
+//
+// Deprecated: kept for backward compatibility; prefer AddPeriodic, which returns a *TimerData
+// that can be reset or canceled.
 func (el *EventLoop) AddPeriodTask(t *PeriodTask) {
-	el.periodTasks = append(el.periodTasks, t)
+	el.AddPeriodic(t.Interval, t.Event)
 }
 
 // SetTriggerDataPtr used to transmit data in library event(e.g. Socket) and user defined event.
@@ -49,87 +95,197 @@ func (el *EventLoop) Run() {
 		}
 	}
 
-	for _, t := range el.periodTasks {
-		t.setNextTriggerTime()
-	}
-
-	for !el.done {
+	for !el.done.Load() {
 		el.Tick()
 	}
+	el.bus.publish(EventLoopStopped, nil)
 }
 
 // Tick waits one cycle of the whole eventloop and processes the corresponding events.
 func (el *EventLoop) Tick() {
+	el.drainRegisterQueue()
+	el.bus.publish(EventTickStarted, nil)
+
 	var (
 		ed        EventData
 		sleepTime = el.interval
 	)
 
-	nearestTask := el.findNearestTask()
-	if nearestTask != nil {
-		sleepTime = nearestTask.nextTriggerTime.Sub(time.Now())
+	if nt := el.timers.next(); nt != nil {
+		if d := nt.expire.Sub(time.Now()); d < sleepTime {
+			sleepTime = d
+		}
+	}
+	if sleepTime < 0 {
+		sleepTime = 0
 	}
 
 	keys, _, _ := el.Selector.Poll(int(sleepTime / time.Millisecond))
+	el.bus.publish(EventPollReturned, PollReturnedPayload{NumKeys: len(keys), WaitMs: int(sleepTime / time.Millisecond)})
+
 	for _, k := range keys {
 		ed = k.Data.(EventData)
+		if ed.bucket != nil && !ed.bucket.refillAndTake(time.Now()) {
+			el.scheduleThrottleRetry(k.Fd, ed)
+			continue
+		}
 		action := ed.e(el, ed.data)
 		el.processAction(action, k.Fd)
 	}
 
-	if nearestTask != nil {
-		nearestTask.Event(el, nil)
-		nearestTask.setNextTriggerTime()
+	quiescing := el.quiescing.Load()
+
+	now := time.Now()
+	for _, td := range el.timers.popExpired(now) {
+		if quiescing && td.period > 0 {
+			// Periodic timers (including AddPeriodic/PeriodTask-derived ones) stop firing
+			// once draining begins; one-shot timers, including ScheduleAt tasks, still fire.
+			el.timers.release(td)
+			continue
+		}
+
+		td.firing = true
+		td.fn(el, nil)
+		td.firing = false
+		el.bus.publish(EventTimerFired, nil)
+
+		switch {
+		case td.canceled:
+			el.timers.release(td)
+		case td.resetPending:
+			// fn called ResetTimer on itself; honor the stashed duration instead of the
+			// timer's own period, whether or not it's periodic. See timerWheel.reset.
+			td.resetPending = false
+			td.expire = now.Add(td.resetDuration)
+			heap.Push(&el.timers.heap, td)
+		case td.period > 0:
+			td.expire = now.Add(td.period)
+			heap.Push(&el.timers.heap, td)
+		default:
+			el.timers.release(td)
+		}
+	}
+
+	if quiescing {
+		// Shutdown only ever flips el.quiescing; draining itself is always driven from here,
+		// on the loop's own goroutine, so it never races with Tick's other state.
+		el.tickDrain()
 	}
 }
 
-// Register registers a event in the internal selector.
+// Register registers a event in the internal selector. Like the rest of EventLoop's state,
+// it must only be called from the loop's own goroutine (e.g. from a Serving, Open or Data
+// callback); a different goroutine handing fd to a loop it doesn't own should call
+// QueueRegister instead.
 func (el *EventLoop) Register(fd int, mask uint32, e EventProc, d interface{}) error {
-	return el.Selector.Register(fd, mask, EventData{e, d})
+	if el.quiescing.Load() {
+		return ErrQuiescing
+	}
+	return el.doRegister(fd, mask, e, d, nil)
 }
 
-// Done broke the running of the server.
-func (el *EventLoop) Done() {
-	el.done = true
+// doRegister performs the actual registration and must only run on the loop's own goroutine:
+// it mutates registeredFDs and fdCount, which are otherwise unsynchronized.
+func (el *EventLoop) doRegister(fd int, mask uint32, e EventProc, d interface{}, bucket *tokenBucket) error {
+	err := el.Selector.Register(fd, mask, EventData{e: e, data: d, bucket: bucket})
+	if err == nil {
+		el.registeredFDs[fd] = struct{}{}
+		el.fdCount++
+		el.bus.publish(EventFDRegistered, FDPayload{FD: fd})
+	}
+	return err
 }
 
-func (el *EventLoop) findNearestTask() *PeriodTask {
-	var ans *PeriodTask
-	for _, t := range el.periodTasks {
-		if ans == nil || t.nextTriggerTime.Before(ans.nextTriggerTime) {
-			ans = t
+// registerRequest is a Register call queued from outside the loop's own goroutine; see
+// QueueRegister and drainRegisterQueue.
+type registerRequest struct {
+	fd     int
+	mask   uint32
+	e      EventProc
+	data   interface{}
+	result chan<- error
+}
+
+// QueueRegister is like Register, except it is safe to call from any goroutine: it only
+// enqueues the request, and the registration itself happens on the loop's own goroutine
+// during its next Tick. The returned channel receives exactly one error once that has
+// happened. This is what LoopPool.Dispatch uses to hand an accepted fd to a loop it doesn't
+// own without racing that loop's own Tick goroutine.
+func (el *EventLoop) QueueRegister(fd int, mask uint32, e EventProc, d interface{}) <-chan error {
+	result := make(chan error, 1)
+	el.regMu.Lock()
+	el.regQueue = append(el.regQueue, &registerRequest{fd: fd, mask: mask, e: e, data: d, result: result})
+	el.regMu.Unlock()
+	return result
+}
+
+// drainRegisterQueue performs every registration queued by QueueRegister since the last Tick.
+// It is only ever called from Tick, i.e. from the loop's own goroutine, so the actual
+// doRegister calls it makes need no synchronization of their own.
+func (el *EventLoop) drainRegisterQueue() {
+	el.regMu.Lock()
+	reqs := el.regQueue
+	el.regQueue = nil
+	el.regMu.Unlock()
+
+	for _, req := range reqs {
+		var err error
+		if el.quiescing.Load() {
+			err = ErrQuiescing
+		} else {
+			err = el.doRegister(req.fd, req.mask, req.e, req.data, nil)
 		}
+		req.result <- err
 	}
-	return ans
+}
+
+// Done broke the running of the server. Unlike most of EventLoop's state, done is safe to set
+// from any goroutine, e.g. LoopPool.Done stopping every loop in a pool from whatever goroutine
+// decided to shut the pool down.
+func (el *EventLoop) Done() {
+	el.done.Store(true)
 }
 
 func (el *EventLoop) processAction(action Action, fd int) {
+	el.bus.publish(EventActionProcessed, ActionProcessedPayload{Action: action, FD: fd})
+
 	switch action {
 	case SHUTDOWN_RD:
 		_, _ = el.Unregister(fd, internal.EV_READABLE)
+		el.cancelThrottleRetry(fd)
+		el.bus.publish(EventFDUnregistered, FDPayload{FD: fd})
 	case SHUTDOWN_WR:
 		_, _ = el.Unregister(fd, internal.EV_WRITABLE)
+		el.cancelThrottleRetry(fd)
+		el.bus.publish(EventFDUnregistered, FDPayload{FD: fd})
 	case SHUTDOWN_RDWR:
 		_, _ = el.Unregister(fd, internal.EV_READABLE)
 		_, _ = el.Unregister(fd, internal.EV_WRITABLE)
+		el.cancelThrottleRetry(fd)
+		delete(el.registeredFDs, fd)
+		el.fdCount--
+		el.bus.publish(EventFDUnregistered, FDPayload{FD: fd})
 	case TRIGGER_OPEN_EVENT:
 		for _, t := range el.events {
 			if t.Open != nil {
 				t.Open(el, el.triggerDataPtr)
 			}
 		}
+		el.bus.publish(EventUserEventTriggered, UserEventTriggeredPayload{Kind: action})
 	case TRIGGER_DATA_EVENT:
 		for _, t := range el.events {
 			if t.Data != nil {
 				t.Data(el, el.triggerDataPtr)
 			}
 		}
+		el.bus.publish(EventUserEventTriggered, UserEventTriggeredPayload{Kind: action})
 	case TRIGGER_CLOSE_EVENT:
 		for _, t := range el.events {
 			if t.Closed != nil {
 				t.Closed(el, el.triggerDataPtr)
 			}
 		}
+		el.bus.publish(EventUserEventTriggered, UserEventTriggeredPayload{Kind: action})
 	case CONTINUE:
 	}
 
@@ -150,6 +306,10 @@ const (
 
 type Event struct {
 	Serving, Open, Closed, Data TriggerProc
+
+	// Draining fires once, when Shutdown begins, so the event can flush pending writes before
+	// its fds are unregistered or force-closed.
+	Draining TriggerProc
 }
 
 type EventProc func(el *EventLoop, data interface{}) Action
@@ -157,17 +317,16 @@ type EventProc func(el *EventLoop, data interface{}) Action
 type EventData struct {
 	e    EventProc
 	data interface{}
+
+	// bucket is non-nil for fds registered via RegisterThrottled.
+	bucket *tokenBucket
 }
 
 type TriggerProc func(el *EventLoop, dataPtr *interface{})
 
+// PeriodTask is the legacy description of a recurring task, accepted by AddPeriodTask for
+// backward compatibility. New code should call AddPeriodic directly.
 type PeriodTask struct {
 	Interval time.Duration
 	Event    TriggerProc
-
-	nextTriggerTime time.Time
-}
-
-func (t *PeriodTask) setNextTriggerTime() {
-	t.nextTriggerTime = time.Now().Add(t.Interval)
 }
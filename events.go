@@ -0,0 +1,139 @@
+package camellia
+
+import (
+	"sync"
+	"time"
+)
+
+// EventKind identifies the category of a LoopEvent published on the EventLoop's event bus. It
+// is a bitmask so Subscribe can select more than one kind at once.
+type EventKind uint32
+
+const (
+	EventTickStarted EventKind = 1 << iota
+	EventPollReturned
+	EventFDRegistered
+	EventFDUnregistered
+	EventActionProcessed
+	EventTimerFired
+	EventUserEventTriggered
+	EventLoopStopped
+
+	// EventAll matches every EventKind.
+	EventAll = EventTickStarted | EventPollReturned | EventFDRegistered | EventFDUnregistered |
+		EventActionProcessed | EventTimerFired | EventUserEventTriggered | EventLoopStopped
+)
+
+// LoopEvent is a single lifecycle notification published by the EventLoop's event bus. Seq is
+// monotonically increasing per EventLoop, so a consumer that reconnects can resume from a
+// "since" cursor without missing events. Dropped reports how many earlier events were lost to
+// buffer overflow before this one, for subscribers that fell behind.
+type LoopEvent struct {
+	Seq     uint64
+	Kind    EventKind
+	Time    time.Time
+	Dropped uint64
+	Payload interface{}
+}
+
+// PollReturnedPayload is the Payload of an EventPollReturned LoopEvent.
+type PollReturnedPayload struct {
+	NumKeys int
+	WaitMs  int
+}
+
+// FDPayload is the Payload of an EventFDRegistered or EventFDUnregistered LoopEvent.
+type FDPayload struct {
+	FD int
+}
+
+// ActionProcessedPayload is the Payload of an EventActionProcessed LoopEvent.
+type ActionProcessedPayload struct {
+	Action Action
+	FD     int
+}
+
+// UserEventTriggeredPayload is the Payload of an EventUserEventTriggered LoopEvent.
+type UserEventTriggeredPayload struct {
+	Kind Action
+}
+
+// defaultEventBufferSize is the per-subscriber ring buffer capacity used by Subscribe.
+const defaultEventBufferSize = 256
+
+// CancelFunc unsubscribes a previously-registered Subscribe channel.
+type CancelFunc func()
+
+type eventSubscriber struct {
+	mask    EventKind
+	ch      chan LoopEvent
+	dropped uint64
+}
+
+type eventBus struct {
+	mu   sync.Mutex
+	seq  uint64
+	subs map[*eventSubscriber]struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[*eventSubscriber]struct{})}
+}
+
+// Subscribe returns a channel of LoopEvents whose Kind is set in mask, plus a CancelFunc to
+// unsubscribe. Each subscriber has its own bounded ring buffer: a slow consumer never blocks
+// the loop, instead its oldest buffered event is dropped to make room, and the Dropped field of
+// the LoopEvent queued in its place reports how many were lost since the previous one queued.
+func (el *EventLoop) Subscribe(mask EventKind) (<-chan LoopEvent, CancelFunc) {
+	sub := &eventSubscriber{
+		mask: mask,
+		ch:   make(chan LoopEvent, defaultEventBufferSize),
+	}
+
+	el.bus.mu.Lock()
+	el.bus.subs[sub] = struct{}{}
+	el.bus.mu.Unlock()
+
+	cancel := func() {
+		el.bus.mu.Lock()
+		delete(el.bus.subs, sub)
+		el.bus.mu.Unlock()
+		close(sub.ch)
+	}
+	return sub.ch, cancel
+}
+
+func (b *eventBus) publish(kind EventKind, payload interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	ev := LoopEvent{Seq: b.seq, Kind: kind, Time: time.Now(), Payload: payload}
+
+	for sub := range b.subs {
+		if sub.mask&kind == 0 {
+			continue
+		}
+
+		out := ev
+		out.Dropped = sub.dropped
+		select {
+		case sub.ch <- out:
+			sub.dropped = 0
+			continue
+		default:
+		}
+
+		select {
+		case <-sub.ch:
+			sub.dropped++
+		default:
+		}
+		out.Dropped = sub.dropped
+		select {
+		case sub.ch <- out:
+			sub.dropped = 0
+		default:
+		}
+	}
+}
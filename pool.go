@@ -0,0 +1,100 @@
+package camellia
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// LoopPool runs N EventLoops, each pinned to its own goroutine/OS thread, turning the
+// single-reactor EventLoop into a multi-reactor server that can use every core without the
+// user hand-writing the sharding. Each loop is independent: it owns its own SetTriggerDataPtr
+// pointer, timers and tasks, with no cross-loop sharing.
+//
+// Connections are expected to be distributed across loops by giving each loop its own
+// SO_REUSEPORT listening socket and registering it with that loop's Register; on platforms
+// without SO_REUSEPORT, Dispatch hands an already-accepted fd to the pool round-robin instead.
+type LoopPool struct {
+	loops   []*EventLoop
+	wg      sync.WaitGroup
+	quiesce chan struct{}
+	once    sync.Once
+	rr      uint64
+}
+
+// NewLoopPool creates a pool of n EventLoops. n is clamped to at least 1.
+func NewLoopPool(n int) *LoopPool {
+	if n <= 0 {
+		n = 1
+	}
+
+	p := &LoopPool{
+		loops:   make([]*EventLoop, n),
+		quiesce: make(chan struct{}),
+	}
+	for i := range p.loops {
+		p.loops[i] = NewEventLoop()
+	}
+	return p
+}
+
+// Loops returns the pool's underlying event loops, e.g. to bind a per-loop SO_REUSEPORT
+// listening socket and Register it on each one individually.
+func (p *LoopPool) Loops() []*EventLoop {
+	return p.loops
+}
+
+// AddEvent adds e to every loop in the pool.
+func (p *LoopPool) AddEvent(e *Event) {
+	for _, el := range p.loops {
+		el.AddEvent(e)
+	}
+}
+
+// AddPeriodTask adds a copy of t to every loop in the pool.
+func (p *LoopPool) AddPeriodTask(t *PeriodTask) {
+	for _, el := range p.loops {
+		el.AddPeriodTask(&PeriodTask{Interval: t.Interval, Event: t.Event})
+	}
+}
+
+// Dispatch hands fd off to the next loop in round-robin order, for platforms where the
+// listener cannot be bound once per loop via SO_REUSEPORT. Dispatch is called from whichever
+// goroutine accepted fd, not from the target loop's own goroutine, so it hands the
+// registration off via QueueRegister rather than calling Register directly; it blocks until
+// that loop's next Tick has actually performed it.
+func (p *LoopPool) Dispatch(fd int, mask uint32, e EventProc, d interface{}) error {
+	i := atomic.AddUint64(&p.rr, 1)
+	return <-p.loops[i%uint64(len(p.loops))].QueueRegister(fd, mask, e, d)
+}
+
+// Run starts every loop in the pool on its own pinned goroutine and blocks until all of them
+// have returned from Run, e.g. after Done is called.
+func (p *LoopPool) Run() {
+	p.wg.Add(len(p.loops))
+	for _, el := range p.loops {
+		el := el
+		go func() {
+			defer p.wg.Done()
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			el.Run()
+		}()
+	}
+	p.wg.Wait()
+}
+
+// Done signals every loop in the pool to stop, cockroachdb Stopper style, and closes the
+// channel returned by Quiesce.
+func (p *LoopPool) Done() {
+	for _, el := range p.loops {
+		el.Done()
+	}
+	p.once.Do(func() { close(p.quiesce) })
+}
+
+// Quiesce returns a channel that is closed once Done has been called, so work fanned out
+// across the pool can bail out cooperatively.
+func (p *LoopPool) Quiesce() <-chan struct{} {
+	return p.quiesce
+}
@@ -0,0 +1,236 @@
+package camellia
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TaskID identifies a task scheduled via ScheduleAt or ScheduleCron, for later use with
+// CancelTask and Reschedule.
+type TaskID uint64
+
+// TaskResultHandler, when set on an EventLoop, is invoked after every ScheduleAt or
+// ScheduleCron task runs, reporting any panic recovered from the task as err. Assign it
+// directly, e.g. el.TaskResultHandler = func(id TaskID, err error) { ... }.
+type TaskResultHandler func(id TaskID, err error)
+
+// cronTask is the bookkeeping the scheduler keeps per TaskID: either a one-shot task (spec and
+// every both zero), a fixed-interval "@every" task, or a parsed 5-field cron task.
+type cronTask struct {
+	id    TaskID
+	fn    TriggerProc
+	every time.Duration
+	spec  *cronSpec
+	timer *TimerData
+}
+
+// ScheduleAt schedules fn to run once, at time t.
+func (el *EventLoop) ScheduleAt(t time.Time, fn TriggerProc) TaskID {
+	return el.newTask(&cronTask{fn: fn}, time.Until(t))
+}
+
+// ScheduleCron schedules fn to run repeatedly according to a standard 5-field cron spec
+// ("minute hour dom month dow"), or the "@every <duration>" shorthand, e.g. "@every 30s".
+func (el *EventLoop) ScheduleCron(spec string, fn TriggerProc) (TaskID, error) {
+	if every, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(every))
+		if err != nil {
+			return 0, fmt.Errorf("camellia: invalid @every spec %q: %w", spec, err)
+		}
+		return el.newTask(&cronTask{fn: fn, every: d}, d), nil
+	}
+
+	cs, err := parseCronSpec(spec)
+	if err != nil {
+		return 0, err
+	}
+	return el.newTask(&cronTask{fn: fn, spec: cs}, time.Until(cs.next(time.Now()))), nil
+}
+
+func (el *EventLoop) newTask(task *cronTask, in time.Duration) TaskID {
+	el.nextTaskID++
+	task.id = el.nextTaskID
+	task.timer = el.AddTimer(in, el.runAndRescheduleTask(task))
+	el.tasks[task.id] = task
+	return task.id
+}
+
+// runAndRescheduleTask wraps task.fn so it reports its outcome to TaskResultHandler and, for
+// recurring tasks, re-arms the next occurrence once it has run.
+func (el *EventLoop) runAndRescheduleTask(task *cronTask) TriggerProc {
+	return func(loopEl *EventLoop, _ *interface{}) {
+		err := loopEl.runTask(task.fn)
+		if loopEl.TaskResultHandler != nil {
+			loopEl.TaskResultHandler(task.id, err)
+		}
+
+		if _, ok := loopEl.tasks[task.id]; !ok {
+			return // canceled from within task.fn, or while it ran
+		}
+
+		switch {
+		case task.every > 0:
+			task.timer = loopEl.AddTimer(task.every, loopEl.runAndRescheduleTask(task))
+		case task.spec != nil:
+			task.timer = loopEl.AddTimer(time.Until(task.spec.next(time.Now())), loopEl.runAndRescheduleTask(task))
+		default:
+			delete(loopEl.tasks, task.id) // one-shot ScheduleAt task
+		}
+	}
+}
+
+func (el *EventLoop) runTask(fn TriggerProc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("camellia: task panicked: %v", r)
+		}
+	}()
+	fn(el, nil)
+	return nil
+}
+
+// CancelTask cancels a pending task scheduled via ScheduleAt or ScheduleCron. It is a no-op if
+// id is unknown, e.g. because the task already fired and was not recurring.
+func (el *EventLoop) CancelTask(id TaskID) {
+	task, ok := el.tasks[id]
+	if !ok {
+		return
+	}
+	el.DelTimer(task.timer)
+	delete(el.tasks, id)
+}
+
+// Reschedule changes when a pending task next fires, without otherwise affecting its
+// recurrence: a cron or "@every" task keeps recurring on its original spec afterwards.
+func (el *EventLoop) Reschedule(id TaskID, d time.Duration) {
+	task, ok := el.tasks[id]
+	if !ok {
+		return
+	}
+	el.ResetTimer(task.timer, d)
+}
+
+// cronSpec is a parsed standard 5-field cron expression. A nil field slice means "any value
+// matches", i.e. the field was "*".
+type cronSpec struct {
+	minutes, hours, doms, months, dows []int
+}
+
+func parseCronSpec(spec string) (*cronSpec, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("camellia: cron spec %q must have 5 fields, got %d", spec, len(fields))
+	}
+
+	minutes, err := parseCronField(fields[0], 0, 59)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := parseCronField(fields[1], 0, 23)
+	if err != nil {
+		return nil, err
+	}
+	doms, err := parseCronField(fields[2], 1, 31)
+	if err != nil {
+		return nil, err
+	}
+	months, err := parseCronField(fields[3], 1, 12)
+	if err != nil {
+		return nil, err
+	}
+	dows, err := parseCronField(fields[4], 0, 6)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cronSpec{minutes: minutes, hours: hours, doms: doms, months: months, dows: dows}, nil
+}
+
+// parseCronField parses a single cron field ("*", "*/n", "a-b", "a,b,c", or a combination of
+// the latter two) into the list of values it matches, or nil for "*" meaning any value.
+func parseCronField(field string, min, max int) ([]int, error) {
+	if field == "*" {
+		return nil, nil
+	}
+
+	var vals []int
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		rangePart := part
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return nil, fmt.Errorf("camellia: invalid cron step %q", part)
+			}
+			step = s
+			rangePart = part[:i]
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			if i := strings.IndexByte(rangePart, '-'); i >= 0 {
+				l, err1 := strconv.Atoi(rangePart[:i])
+				h, err2 := strconv.Atoi(rangePart[i+1:])
+				if err1 != nil || err2 != nil {
+					return nil, fmt.Errorf("camellia: invalid cron range %q", rangePart)
+				}
+				lo, hi = l, h
+			} else {
+				v, err := strconv.Atoi(rangePart)
+				if err != nil {
+					return nil, fmt.Errorf("camellia: invalid cron value %q", rangePart)
+				}
+				lo, hi = v, v
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("camellia: cron field %q out of range [%d, %d]", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			vals = append(vals, v)
+		}
+	}
+	return vals, nil
+}
+
+func matchesCronField(vals []int, v int) bool {
+	if vals == nil {
+		return true
+	}
+	for _, x := range vals {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// domDowMatches applies standard cron day-of-month/day-of-week semantics: if both fields are
+// restricted (neither is the "*" wildcard), a match on either is enough, e.g. "0 0 1 * 1" means
+// "midnight on the 1st of the month, or every Monday", not their conjunction. If only one of
+// the two is restricted, it alone must match, since the other is trivially satisfied by "*".
+func (s *cronSpec) domDowMatches(t time.Time) bool {
+	if s.doms != nil && s.dows != nil {
+		return matchesCronField(s.doms, t.Day()) || matchesCronField(s.dows, int(t.Weekday()))
+	}
+	return matchesCronField(s.doms, t.Day()) && matchesCronField(s.dows, int(t.Weekday()))
+}
+
+// next returns the next minute, strictly after from, matching the spec. It scans forward
+// minute by minute for up to eight years, which is enough for any valid 5-field spec, including
+// one that only matches Feb 29 across a skipped leap year such as 2100.
+func (s *cronSpec) next(from time.Time) time.Time {
+	t := from.Add(time.Minute).Truncate(time.Minute)
+	for i := 0; i < 8*366*24*60; i++ {
+		if matchesCronField(s.months, int(t.Month())) &&
+			matchesCronField(s.hours, t.Hour()) &&
+			matchesCronField(s.minutes, t.Minute()) &&
+			s.domDowMatches(t) {
+			return t
+		}
+		t = t.Add(time.Minute)
+	}
+	return from.Add(24 * time.Hour)
+}
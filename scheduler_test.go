@@ -0,0 +1,77 @@
+package camellia
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	cases := []struct {
+		field    string
+		min, max int
+		want     []int
+	}{
+		{"*", 0, 59, nil},
+		{"5", 0, 59, []int{5}},
+		{"1-3", 0, 59, []int{1, 2, 3}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"1,3,5", 0, 59, []int{1, 3, 5}},
+	}
+
+	for _, c := range cases {
+		got, err := parseCronField(c.field, c.min, c.max)
+		if err != nil {
+			t.Fatalf("parseCronField(%q) error: %v", c.field, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseCronField(%q) = %v, want %v", c.field, got, c.want)
+		}
+	}
+}
+
+func TestCronSpecNextEveryMinute(t *testing.T) {
+	cs, err := parseCronSpec("* * * * *")
+	if err != nil {
+		t.Fatalf("parseCronSpec error: %v", err)
+	}
+
+	from := time.Date(2026, 1, 1, 12, 30, 15, 0, time.UTC)
+	next := cs.next(from)
+	want := time.Date(2026, 1, 1, 12, 31, 0, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Errorf("next = %v, want %v", next, want)
+	}
+}
+
+// TestCronSpecDomDowOred checks standard cron semantics: when both dom and dow are restricted,
+// a match on either field is enough. 2026-01-05 is a Monday but not the 1st of the month.
+func TestCronSpecDomDowOred(t *testing.T) {
+	cs, err := parseCronSpec("0 0 1 * 1")
+	if err != nil {
+		t.Fatalf("parseCronSpec error: %v", err)
+	}
+
+	from := time.Date(2026, 1, 4, 23, 59, 0, 0, time.UTC)
+	next := cs.next(from)
+	want := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Errorf("next = %v, want %v (dom/dow should be ORed when both are restricted)", next, want)
+	}
+}
+
+// TestCronSpecDomOnlyIsAnded checks that a "*" dow does not turn an OR into always-true: with
+// dow unrestricted, only dom need match.
+func TestCronSpecDomOnlyIsAnded(t *testing.T) {
+	cs, err := parseCronSpec("0 0 1 * *")
+	if err != nil {
+		t.Fatalf("parseCronSpec error: %v", err)
+	}
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	next := cs.next(from)
+	want := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Errorf("next = %v, want %v", next, want)
+	}
+}
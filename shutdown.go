@@ -0,0 +1,104 @@
+package camellia
+
+import (
+	"context"
+	"errors"
+
+	"github.com/arianxx/camellia-io/internal"
+)
+
+// ErrQuiescing is returned by Register and RegisterThrottled once Shutdown has begun, since
+// the loop is no longer accepting new registrations.
+var ErrQuiescing = errors.New("camellia: event loop is shutting down")
+
+// ShouldQuiesce returns a channel that is closed the instant a graceful shutdown begins, so
+// long-running user callbacks can poll it and bail out mid-work, cockroachdb Stopper style.
+// It says nothing about whether draining has finished; for that, see Shutdown's return.
+func (el *EventLoop) ShouldQuiesce() <-chan struct{} {
+	return el.quiesceCh
+}
+
+// AddShutdownHook registers fn to run exactly once, after draining completes, just before Run
+// returns. Hooks run in registration order.
+func (el *EventLoop) AddShutdownHook(fn TriggerProc) {
+	el.shutdownHooks = append(el.shutdownHooks, fn)
+}
+
+// Shutdown begins a graceful shutdown and blocks until it completes or ctx is done, whichever
+// happens first. The actual draining (firing each Event's Draining callback, then ticking
+// until every fd is unregistered or the first caller's ctx expires, then force-closing any
+// stragglers and running shutdown hooks) all happens on the single goroutine already running
+// Run's Tick loop, driven by tickDrain — Shutdown itself never calls Tick, so it is safe to
+// call from a different goroutine than the one blocked in Run, e.g. `go el.Run()` paired with
+// `el.Shutdown(ctx)` from a signal handler.
+//
+// Shutdown may be called more than once, including concurrently; only the first call's ctx
+// governs the drain deadline. Every call blocks until draining is complete (returning its
+// outcome) or until its own ctx is done (returning that ctx's error), independent of the
+// others.
+func (el *EventLoop) Shutdown(ctx context.Context) error {
+	el.shutdownOnce.Do(func() {
+		el.shutdownCtx.Store(ctx)
+		close(el.quiesceCh)
+		el.quiescing.Store(true)
+	})
+
+	select {
+	case <-el.shutdownDone:
+		return el.shutdownErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tickDrain advances the shutdown state machine by one step. It is only ever called from
+// Tick, i.e. from the loop's own goroutine, once el.quiescing has been observed true, so
+// everything it touches (el.draining, el.shutdownHooks, el.registeredFDs, el.fdCount) needs no
+// synchronization of its own; el.done is set through its atomic setter since Done may also set
+// it concurrently from another goroutine.
+func (el *EventLoop) tickDrain() {
+	if !el.draining {
+		el.draining = true
+		for _, e := range el.events {
+			if e.Draining != nil {
+				e.Draining(el, nil)
+			}
+		}
+	}
+
+	ctx, _ := el.shutdownCtx.Load().(context.Context)
+	ctxDone := ctx != nil && ctx.Err() != nil
+	if el.fdCount > 0 && !ctxDone {
+		return
+	}
+
+	if ctxDone {
+		el.forceCloseRemaining()
+	}
+
+	el.runShutdownHooks()
+	if ctx != nil {
+		el.shutdownErr = ctx.Err()
+	}
+	close(el.shutdownDone)
+	el.done.Store(true)
+}
+
+func (el *EventLoop) runShutdownHooks() {
+	hooks := el.shutdownHooks
+	el.shutdownHooks = nil
+	for _, fn := range hooks {
+		fn(el, nil)
+	}
+}
+
+func (el *EventLoop) forceCloseRemaining() {
+	for fd := range el.registeredFDs {
+		_, _ = el.Unregister(fd, internal.EV_READABLE)
+		_, _ = el.Unregister(fd, internal.EV_WRITABLE)
+		el.cancelThrottleRetry(fd)
+		delete(el.registeredFDs, fd)
+		el.fdCount--
+		el.bus.publish(EventFDUnregistered, FDPayload{FD: fd})
+	}
+}
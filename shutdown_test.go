@@ -0,0 +1,93 @@
+package camellia
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestEventLoop builds an EventLoop without internal.New, since the internal Selector is
+// not needed to exercise the shutdown state machine directly, only tickDrain and Shutdown.
+func newTestEventLoop() *EventLoop {
+	return &EventLoop{
+		events:          []*Event{},
+		timers:          newTimerWheel(),
+		bus:             newEventBus(),
+		tasks:           map[TaskID]*cronTask{},
+		quiesceCh:       make(chan struct{}),
+		shutdownDone:    make(chan struct{}),
+		registeredFDs:   map[int]struct{}{},
+		throttleRetries: map[int]*TimerData{},
+		interval:        100 * time.Millisecond,
+	}
+}
+
+// TestShutdownSecondCallerWaitsForDrain guards against a second, concurrent Shutdown call
+// reporting completion before draining has actually finished: it must keep blocking until the
+// loop's own goroutine (simulated here by directly calling tickDrain) closes shutdownDone.
+func TestShutdownSecondCallerWaitsForDrain(t *testing.T) {
+	el := newTestEventLoop()
+	el.fdCount = 1 // pretend one fd is still draining
+
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	results := make([]error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = el.Shutdown(ctx)
+		}(i)
+	}
+
+	time.Sleep(20 * time.Millisecond) // let both goroutines enter Shutdown and block
+
+	select {
+	case <-el.shutdownDone:
+		t.Fatal("shutdownDone closed before the loop goroutine ever drained anything")
+	default:
+	}
+
+	// Only the loop's own goroutine drives draining; simulate the last fd going away and the
+	// loop noticing on its next Tick.
+	el.fdCount = 0
+	el.tickDrain()
+
+	wg.Wait()
+	for i, err := range results {
+		if err != nil {
+			t.Errorf("Shutdown()[%d] = %v, want nil", i, err)
+		}
+	}
+}
+
+func TestTickDrainFiresDrainingAndHooksOnce(t *testing.T) {
+	el := newTestEventLoop()
+
+	var drained, hookRuns int
+	el.AddEvent(&Event{Draining: func(*EventLoop, *interface{}) { drained++ }})
+	el.AddShutdownHook(func(*EventLoop, *interface{}) { hookRuns++ })
+
+	el.shutdownCtx.Store(context.Background())
+	el.quiescing.Store(true)
+	close(el.quiesceCh)
+
+	el.tickDrain() // fdCount is 0, so a single call should finish the whole drain
+
+	if !el.done.Load() {
+		t.Fatal("tickDrain should set el.done once draining completes with no fds left")
+	}
+	select {
+	case <-el.shutdownDone:
+	default:
+		t.Fatal("tickDrain did not close shutdownDone")
+	}
+	if drained != 1 {
+		t.Errorf("Draining fired %d times, want 1", drained)
+	}
+	if hookRuns != 1 {
+		t.Errorf("shutdown hook ran %d times, want 1", hookRuns)
+	}
+}
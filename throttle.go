@@ -0,0 +1,102 @@
+package camellia
+
+import "time"
+
+// tokenBucket caps how often its owner's EventProc may fire, independent of how often the
+// underlying fd becomes ready.
+type tokenBucket struct {
+	rate  time.Duration
+	burst int
+
+	tokens int
+	last   time.Time
+}
+
+func newTokenBucket(rate time.Duration, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if b.tokens >= b.burst {
+		b.last = now
+		return
+	}
+	if n := int(now.Sub(b.last) / b.rate); n > 0 {
+		b.tokens += n
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = b.last.Add(time.Duration(n) * b.rate)
+	}
+}
+
+// take reports whether a token is available and, if so, consumes one.
+func (b *tokenBucket) take() bool {
+	if b.tokens <= 0 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// refillAndTake refills the bucket up to now, then attempts to take a token.
+func (b *tokenBucket) refillAndTake(now time.Time) bool {
+	b.refill(now)
+	return b.take()
+}
+
+// nextEligible is the earliest instant a token will next become available.
+func (b *tokenBucket) nextEligible() time.Time {
+	return b.last.Add(b.rate)
+}
+
+// RegisterThrottled is like Register, but caps how often e fires to rate (with burst allowed
+// immediately), regardless of how often fd becomes readable/writable. When the bucket is
+// empty, e is deferred to a one-shot timer at the bucket's next eligible instant instead of
+// being invoked immediately, so a hot fd can't hammer downstream work, e.g. outbound polling
+// done from within the loop.
+func (el *EventLoop) RegisterThrottled(fd int, mask uint32, e EventProc, d interface{}, rate time.Duration, burst int) error {
+	if el.quiescing.Load() {
+		return ErrQuiescing
+	}
+
+	return el.doRegister(fd, mask, e, d, newTokenBucket(rate, burst))
+}
+
+// scheduleThrottleRetry defers a throttled callback until its token bucket's next eligible
+// instant, then re-enters it exactly as if fd had become ready again. The pending retry is
+// tracked in el.throttleRetries so that cancelThrottleRetry can cancel it if fd is unregistered
+// before the retry fires, e.g. because the connection closed while throttled. At most one
+// retry is pending per fd: if fd becomes ready again while one is pending, that one serves it.
+func (el *EventLoop) scheduleThrottleRetry(fd int, ed EventData) {
+	if _, pending := el.throttleRetries[fd]; pending {
+		return
+	}
+
+	d := ed.bucket.nextEligible().Sub(time.Now())
+	if d < 0 {
+		d = 0
+	}
+
+	td := el.AddTimer(d, func(loopEl *EventLoop, _ *interface{}) {
+		delete(loopEl.throttleRetries, fd)
+		if !ed.bucket.refillAndTake(time.Now()) {
+			loopEl.scheduleThrottleRetry(fd, ed)
+			return
+		}
+		action := ed.e(loopEl, ed.data)
+		loopEl.processAction(action, fd)
+	})
+	el.throttleRetries[fd] = td
+}
+
+// cancelThrottleRetry cancels any pending throttle retry timer for fd, so a deferred callback
+// never fires against an fd number that has since been unregistered and possibly reused.
+func (el *EventLoop) cancelThrottleRetry(fd int) {
+	td, ok := el.throttleRetries[fd]
+	if !ok {
+		return
+	}
+	el.DelTimer(td)
+	delete(el.throttleRetries, fd)
+}
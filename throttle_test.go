@@ -0,0 +1,34 @@
+package camellia
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketBurstThenThrottle(t *testing.T) {
+	b := newTokenBucket(100*time.Millisecond, 2)
+
+	if !b.take() {
+		t.Fatal("expected first token from burst to be available")
+	}
+	if !b.take() {
+		t.Fatal("expected second token from burst to be available")
+	}
+	if b.take() {
+		t.Fatal("expected burst to be exhausted")
+	}
+}
+
+func TestTokenBucketRefillsOverTime(t *testing.T) {
+	b := newTokenBucket(100*time.Millisecond, 1)
+	if !b.take() {
+		t.Fatal("expected initial token to be available")
+	}
+
+	if b.refillAndTake(b.last.Add(50 * time.Millisecond)) {
+		t.Fatal("expected no token to be available before a full rate interval has passed")
+	}
+	if !b.refillAndTake(b.last.Add(150 * time.Millisecond)) {
+		t.Fatal("expected a token to be available after a full rate interval has passed")
+	}
+}
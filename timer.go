@@ -0,0 +1,170 @@
+package camellia
+
+import (
+	"container/heap"
+	"time"
+)
+
+// TimerData represents a single timer managed by the EventLoop's timer wheel, either a
+// one-shot timer added via AddTimer or a recurring one added via AddPeriodic. It is returned
+// to the caller so the timer can later be rescheduled with ResetTimer or canceled with
+// DelTimer without having to search for it again.
+type TimerData struct {
+	expire time.Time
+	period time.Duration // zero for one-shot timers, otherwise the recurrence interval
+	fn     TriggerProc
+
+	index    int // position in the heap, maintained by container/heap; -1 when not queued
+	canceled bool
+	firing   bool // true while Tick is running this timer's own fn; see del and reset
+
+	// resetPending and resetDuration stash a ResetTimer call made from within td's own fn,
+	// since td is popped out of the heap while firing and has no index for heap.Fix to use;
+	// see reset and Tick's expired-timer loop, which applies them once fn returns.
+	resetPending  bool
+	resetDuration time.Duration
+}
+
+// timerHeap is a container/heap.Interface over *TimerData ordered by expire time.
+type timerHeap []*TimerData
+
+func (h timerHeap) Len() int            { return len(h) }
+func (h timerHeap) Less(i, j int) bool  { return h[i].expire.Before(h[j].expire) }
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x interface{}) {
+	td := x.(*TimerData)
+	td.index = len(*h)
+	*h = append(*h, td)
+}
+
+func (h *timerHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	td := old[n-1]
+	old[n-1] = nil
+	td.index = -1
+	*h = old[:n-1]
+	return td
+}
+
+// timerWheel owns the min-heap of pending timers plus a free-list of TimerData nodes, so that
+// high-churn workloads (thousands of heartbeat timers being added, reset and deleted) don't
+// keep pressuring the GC with fresh allocations.
+type timerWheel struct {
+	heap     timerHeap
+	freeList []*TimerData
+}
+
+func newTimerWheel() *timerWheel {
+	return &timerWheel{}
+}
+
+func (w *timerWheel) alloc() *TimerData {
+	if n := len(w.freeList); n > 0 {
+		td := w.freeList[n-1]
+		w.freeList = w.freeList[:n-1]
+		*td = TimerData{}
+		return td
+	}
+	return &TimerData{}
+}
+
+func (w *timerWheel) release(td *TimerData) {
+	td.fn = nil
+	w.freeList = append(w.freeList, td)
+}
+
+func (w *timerWheel) add(d, period time.Duration, fn TriggerProc) *TimerData {
+	td := w.alloc()
+	td.expire = time.Now().Add(d)
+	td.period = period
+	td.fn = fn
+	heap.Push(&w.heap, td)
+	return td
+}
+
+// reset reschedules td to fire after d from now. It is a no-op if td has already fired (and
+// was one-shot) or was deleted. If td is currently popped out of the heap because Tick is in
+// the middle of running its own fn (the common "reschedule myself with a new backoff" pattern,
+// calling ResetTimer from within the callback), index is already -1 and there is nothing for
+// heap.Fix to operate on; reset instead stashes d on td, for Tick's expired-timer loop to apply
+// once fn returns, instead of silently dropping it.
+func (w *timerWheel) reset(td *TimerData, d time.Duration) {
+	if td.canceled {
+		return
+	}
+	if td.firing {
+		td.resetPending = true
+		td.resetDuration = d
+		return
+	}
+	if td.index < 0 {
+		return // already fired as a one-shot and released; nothing to reschedule
+	}
+	td.expire = time.Now().Add(d)
+	heap.Fix(&w.heap, td.index)
+}
+
+// del cancels td. If td is currently popped out of the heap because Tick is in the middle of
+// running its own fn (the common "fire N times then cancel itself" pattern, calling DelTimer
+// from within the callback), index is already -1; del only has td.canceled to signal Tick not
+// to re-queue it once fn returns. Otherwise td is still queued, so del removes it from the
+// heap directly and returns its node to the free-list itself.
+func (w *timerWheel) del(td *TimerData) {
+	if td.canceled {
+		return
+	}
+	td.canceled = true
+	if td.firing {
+		return // Tick releases td itself once fn returns; see Tick's expired-timer loop.
+	}
+	if td.index < 0 {
+		td.canceled = false // already fired as a one-shot and released; nothing to cancel
+		return
+	}
+	heap.Remove(&w.heap, td.index)
+	w.release(td)
+}
+
+// next returns the soonest-expiring timer, or nil if none are pending.
+func (w *timerWheel) next() *TimerData {
+	if len(w.heap) == 0 {
+		return nil
+	}
+	return w.heap[0]
+}
+
+// popExpired pops and returns every timer whose expire time is at or before now.
+func (w *timerWheel) popExpired(now time.Time) []*TimerData {
+	var fired []*TimerData
+	for len(w.heap) > 0 && !w.heap[0].expire.After(now) {
+		fired = append(fired, heap.Pop(&w.heap).(*TimerData))
+	}
+	return fired
+}
+
+// AddTimer schedules fn to fire once, after d has elapsed.
+func (el *EventLoop) AddTimer(d time.Duration, fn TriggerProc) *TimerData {
+	return el.timers.add(d, 0, fn)
+}
+
+// AddPeriodic schedules fn to fire every d, starting d from now, and then every d thereafter.
+func (el *EventLoop) AddPeriodic(d time.Duration, fn TriggerProc) *TimerData {
+	return el.timers.add(d, d, fn)
+}
+
+// ResetTimer reschedules td to fire d from now, preserving whether it is one-shot or periodic.
+func (el *EventLoop) ResetTimer(td *TimerData, d time.Duration) {
+	el.timers.reset(td, d)
+}
+
+// DelTimer cancels td. It is a no-op if td already fired as a one-shot timer or was already
+// deleted.
+func (el *EventLoop) DelTimer(td *TimerData) {
+	el.timers.del(td)
+}
@@ -0,0 +1,130 @@
+package camellia
+
+import (
+	"container/heap"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimerWheelOrdersByExpiry(t *testing.T) {
+	w := newTimerWheel()
+
+	var order []int
+	mk := func(i int) TriggerProc {
+		return func(*EventLoop, *interface{}) { order = append(order, i) }
+	}
+
+	w.add(30*time.Millisecond, 0, mk(2))
+	w.add(10*time.Millisecond, 0, mk(0))
+	w.add(20*time.Millisecond, 0, mk(1))
+
+	now := time.Now().Add(time.Hour) // far enough that all three are expired
+	for _, td := range w.popExpired(now) {
+		td.fn(nil, nil)
+	}
+
+	if want := []int{0, 1, 2}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("fire order = %v, want %v", order, want)
+	}
+}
+
+func TestTimerWheelReset(t *testing.T) {
+	w := newTimerWheel()
+	td := w.add(10*time.Millisecond, 0, func(*EventLoop, *interface{}) {})
+
+	w.reset(td, time.Hour)
+
+	if fired := w.popExpired(time.Now().Add(20 * time.Millisecond)); len(fired) != 0 {
+		t.Fatalf("reset timer fired early: got %d fired", len(fired))
+	}
+	if fired := w.popExpired(time.Now().Add(2 * time.Hour)); len(fired) != 1 {
+		t.Fatalf("reset timer never fired: got %d fired", len(fired))
+	}
+}
+
+func TestTimerWheelDel(t *testing.T) {
+	w := newTimerWheel()
+	td := w.add(10*time.Millisecond, 0, func(*EventLoop, *interface{}) {})
+	w.del(td)
+
+	if fired := w.popExpired(time.Now().Add(time.Hour)); len(fired) != 0 {
+		t.Fatalf("deleted timer fired: got %d fired", len(fired))
+	}
+}
+
+// tickExpired replicates Tick's expired-timer loop by hand, for tests that need to exercise
+// self-cancel/self-reset from within a timer's own callback without spinning up an EventLoop.
+func tickExpired(w *timerWheel, now time.Time) {
+	for _, fired := range w.popExpired(now) {
+		fired.firing = true
+		fired.fn(nil, nil)
+		fired.firing = false
+
+		switch {
+		case fired.canceled:
+			w.release(fired)
+		case fired.resetPending:
+			fired.resetPending = false
+			fired.expire = now.Add(fired.resetDuration)
+			heap.Push(&w.heap, fired)
+		case fired.period > 0:
+			fired.expire = now.Add(fired.period)
+			heap.Push(&w.heap, fired)
+		default:
+			w.release(fired)
+		}
+	}
+}
+
+// TestTimerWheelSelfCancelFromCallback verifies that a periodic timer calling DelTimer on
+// itself, from within its own callback, actually stops recurring rather than being silently
+// re-queued.
+func TestTimerWheelSelfCancelFromCallback(t *testing.T) {
+	w := newTimerWheel()
+	var runs int
+	var td *TimerData
+
+	td = w.add(10*time.Millisecond, 10*time.Millisecond, func(*EventLoop, *interface{}) {
+		runs++
+		if runs == 2 {
+			w.del(td)
+		}
+	})
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		now = now.Add(time.Hour)
+		tickExpired(w, now)
+	}
+
+	if runs != 2 {
+		t.Fatalf("runs = %d, want 2 (timer should have canceled itself after the second run)", runs)
+	}
+}
+
+// TestTimerWheelSelfResetFromCallback verifies that a one-shot timer calling ResetTimer on
+// itself, from within its own callback (e.g. a backoff loop), is re-queued at the new duration
+// instead of being silently dropped because it was popped out of the heap while firing.
+func TestTimerWheelSelfResetFromCallback(t *testing.T) {
+	w := newTimerWheel()
+	var runs int
+	var td *TimerData
+
+	td = w.add(10*time.Millisecond, 0, func(*EventLoop, *interface{}) {
+		runs++
+		if runs < 3 {
+			w.reset(td, 10*time.Millisecond)
+		}
+	})
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		now = now.Add(time.Hour)
+		tickExpired(w, now)
+	}
+
+	if runs != 3 {
+		t.Fatalf("runs = %d, want 3 (timer should have stopped rescheduling itself after the third run)", runs)
+	}
+}